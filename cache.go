@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// cacheShardCount 决定ProgramData按频道ID哈希分片的数量，
+// 分片可以让查询与后台重建并发进行而不互相阻塞。
+const cacheShardCount = 32
+
+// programShard 是ProgramData的一个分片，独立加锁
+type programShard struct {
+	mu     sync.RWMutex
+	data   map[string]map[string][]ProgramItem // 频道ID→日期→节目列表
+	sorted map[string][]ProgramItem            // 频道ID→按Start升序排列的节目（跨日期），供now/next/at二分查找
+}
+
+// EPGCache 内存缓存结构。一次重建会产生一个全新的EPGCache实例，
+// 通过epgCache这个atomic.Pointer整体替换，读请求因此永远不会等待重建的写锁。
+type EPGCache struct {
+	// ChannelMaps 按语言区分的 频道名称→频道ID 映射：lang → 频道名称 → 频道ID
+	ChannelMaps map[string]map[string]string
+	shards      [cacheShardCount]*programShard
+}
+
+// cacheDTO 是EPGCache落盘/恢复时使用的扁平结构
+type cacheDTO struct {
+	ChannelMaps map[string]map[string]string        `json:"channel_maps"`
+	ProgramData map[string]map[string][]ProgramItem `json:"program_data"`
+}
+
+func newEPGCache() *EPGCache {
+	c := &EPGCache{ChannelMaps: make(map[string]map[string]string)}
+	for i := range c.shards {
+		c.shards[i] = newProgramShard()
+	}
+	return c
+}
+
+func newProgramShard() *programShard {
+	return &programShard{
+		data:   make(map[string]map[string][]ProgramItem),
+		sorted: make(map[string][]ProgramItem),
+	}
+}
+
+// shardFor 按频道ID的fnv32哈希选择分片
+func (c *EPGCache) shardFor(channelID string) *programShard {
+	h := fnv.New32a()
+	h.Write([]byte(channelID))
+	return c.shards[h.Sum32()%cacheShardCount]
+}
+
+// hasChannel 判断频道ID是否存在节目数据
+func (c *EPGCache) hasChannel(channelID string) bool {
+	shard := c.shardFor(channelID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	_, ok := shard.data[channelID]
+	return ok
+}
+
+// programsOn 返回某频道在某天的节目列表（调用方拿到的是副本，可安全修改）
+func (c *EPGCache) programsOn(channelID, date string) []ProgramItem {
+	shard := c.shardFor(channelID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	items := shard.data[channelID][date]
+	if len(items) == 0 {
+		return nil
+	}
+	out := make([]ProgramItem, len(items))
+	copy(out, items)
+	return out
+}
+
+// addProgram 向分片追加一条节目记录，仅在重建阶段由构建协程调用
+func (c *EPGCache) addProgram(channelID, date string, item ProgramItem) {
+	shard := c.shardFor(channelID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if shard.data[channelID] == nil {
+		shard.data[channelID] = make(map[string][]ProgramItem)
+	}
+	shard.data[channelID][date] = append(shard.data[channelID][date], item)
+	shard.sorted[channelID] = append(shard.sorted[channelID], item)
+}
+
+// sortedProgramsForChannel 返回某频道全部节目，按Start升序排列（跨日期），
+// now/next/at在此基础上用sort.Search做二分查找，而不必逐天扫描
+func (c *EPGCache) sortedProgramsForChannel(channelID string) []ProgramItem {
+	shard := c.shardFor(channelID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	items := shard.sorted[channelID]
+	out := make([]ProgramItem, len(items))
+	copy(out, items)
+	return out
+}
+
+// finalizeIndex 在一次重建的最后，把每个频道的节目列表按Start排序，
+// 使查询阶段可以直接二分查找
+func (c *EPGCache) finalizeIndex() {
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		for channelID := range shard.sorted {
+			items := shard.sorted[channelID]
+			sort.Slice(items, func(i, j int) bool { return items[i].Start.Before(items[j].Start) })
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// datesForChannel 返回某频道当前缓存中有节目数据的全部日期（未排序）
+func (c *EPGCache) datesForChannel(channelID string) []string {
+	shard := c.shardFor(channelID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	dates := make([]string, 0, len(shard.data[channelID]))
+	for d := range shard.data[channelID] {
+		dates = append(dates, d)
+	}
+	return dates
+}
+
+// MarshalJSON 将分片数据拍平为单一map，便于落盘
+func (c *EPGCache) MarshalJSON() ([]byte, error) {
+	dto := cacheDTO{
+		ChannelMaps: c.ChannelMaps,
+		ProgramData: make(map[string]map[string][]ProgramItem),
+	}
+	for _, shard := range c.shards {
+		shard.mu.RLock()
+		for channelID, dates := range shard.data {
+			dto.ProgramData[channelID] = dates
+		}
+		shard.mu.RUnlock()
+	}
+	return json.Marshal(dto)
+}
+
+// UnmarshalJSON 从落盘的扁平结构恢复出分片缓存
+func (c *EPGCache) UnmarshalJSON(b []byte) error {
+	var dto cacheDTO
+	if err := json.Unmarshal(b, &dto); err != nil {
+		return err
+	}
+
+	c.ChannelMaps = dto.ChannelMaps
+	if c.ChannelMaps == nil {
+		c.ChannelMaps = make(map[string]map[string]string)
+	}
+	for i := range c.shards {
+		c.shards[i] = newProgramShard()
+	}
+	for channelID, dates := range dto.ProgramData {
+		shard := c.shardFor(channelID)
+		shard.data[channelID] = dates
+		for _, items := range dates {
+			shard.sorted[channelID] = append(shard.sorted[channelID], items...)
+		}
+	}
+	c.finalizeIndex()
+	return nil
+}
+
+// epgCache 是当前对外提供服务的缓存，重建完成后整体原子替换
+var epgCache atomic.Pointer[EPGCache]
+
+func init() {
+	epgCache.Store(newEPGCache())
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestEPGCacheAddAndQuery 验证分片缓存的基本写入/查询路径
+func TestEPGCacheAddAndQuery(t *testing.T) {
+	c := newEPGCache()
+	start := time.Date(2026, 2, 12, 1, 0, 0, 0, time.UTC)
+	item := ProgramItem{Start: start, End: start.Add(time.Hour), Title: "News"}
+	c.addProgram("cctv1", "2026-02-12", item)
+
+	if !c.hasChannel("cctv1") {
+		t.Fatal("期望cctv1存在节目数据")
+	}
+	if c.hasChannel("cctv2") {
+		t.Fatal("cctv2不应存在节目数据")
+	}
+
+	items := c.programsOn("cctv1", "2026-02-12")
+	if len(items) != 1 || items[0].Title != "News" {
+		t.Fatalf("期望查到1条News节目，实际为%+v", items)
+	}
+
+	// programsOn返回的是副本，调用方修改不应影响缓存内部状态
+	items[0].Title = "Modified"
+	if got := c.programsOn("cctv1", "2026-02-12")[0].Title; got != "News" {
+		t.Fatalf("programsOn应返回副本，但缓存内部状态被修改为%q", got)
+	}
+}
+
+// TestEPGCacheMarshalRoundTrip 验证落盘/恢复后频道映射与节目数据（含排序索引）保持一致
+func TestEPGCacheMarshalRoundTrip(t *testing.T) {
+	c := newEPGCache()
+	c.ChannelMaps["zh"] = map[string]string{"CCTV1": "cctv1"}
+	start := time.Date(2026, 2, 12, 1, 0, 0, 0, time.UTC)
+	c.addProgram("cctv1", "2026-02-12", ProgramItem{Start: start, End: start.Add(time.Hour), Title: "News"})
+	c.finalizeIndex()
+
+	data, err := c.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON失败: %v", err)
+	}
+
+	restored := newEPGCache()
+	if err := restored.UnmarshalJSON(data); err != nil {
+		t.Fatalf("UnmarshalJSON失败: %v", err)
+	}
+
+	if restored.ChannelMaps["zh"]["CCTV1"] != "cctv1" {
+		t.Fatalf("频道映射未正确恢复: %+v", restored.ChannelMaps)
+	}
+	if !restored.hasChannel("cctv1") {
+		t.Fatal("恢复后应存在cctv1的节目数据")
+	}
+
+	sorted := restored.sortedProgramsForChannel("cctv1")
+	if len(sorted) != 1 || !sorted[0].Start.Equal(start) {
+		t.Fatalf("恢复后的排序索引不正确: %+v", sorted)
+	}
+}
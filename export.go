@@ -0,0 +1,180 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	xmltvGeneratorInfoName = "epg-server"
+	xmltvSourceInfoURL     = "epg-server://cache"
+)
+
+// xmltvExportHandler 处理 GET /xmltv.xml 与 /xmltv.xml.gz，
+// 把内存中的epgCache重新序列化为标准XMLTV，供Kodi/Jellyfin/Tvheadend等下游客户端直接订阅。
+// 支持的查询参数：
+//
+//	channels  逗号分隔的频道名称或频道ID列表，缺省导出全部频道
+//	from/to   日期范围（YYYY-MM-DD，含两端），缺省导出全部已缓存日期
+func xmltvExportHandler(w http.ResponseWriter, r *http.Request) {
+	cache := epgCache.Load()
+	query := r.URL.Query()
+
+	var wantChannels map[string]bool
+	if channelsParam := query.Get("channels"); channelsParam != "" {
+		wantChannels = make(map[string]bool)
+		for _, name := range strings.Split(channelsParam, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if id, ok := resolveChannelID(cache, name); ok {
+				wantChannels[id] = true
+			} else {
+				// 允许调用方直接传频道ID
+				wantChannels[name] = true
+			}
+		}
+	}
+
+	from, to, hasRange, err := parseExportRange(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tv := buildExportTV(cache, wantChannels, from, to, hasRange)
+
+	useGzip := strings.HasSuffix(r.URL.Path, ".gz") || strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	var out io.Writer = w
+	if useGzip {
+		w.Header().Set("Content-Encoding", "gzip")
+		gzWriter := gzip.NewWriter(w)
+		defer gzWriter.Close()
+		out = gzWriter
+	}
+
+	io.WriteString(out, xml.Header)
+	encoder := xml.NewEncoder(out)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(tv); err != nil {
+		logError("导出XMLTV失败: %v", err)
+	}
+}
+
+// resolveChannelID 按任意语言的ChannelMap将显示名称解析为频道ID
+func resolveChannelID(cache *EPGCache, name string) (string, bool) {
+	for _, chMap := range cache.ChannelMaps {
+		if id, ok := chMap[name]; ok {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// parseExportRange 解析from/to参数，hasRange为false时表示未指定，导出全部已缓存日期
+func parseExportRange(query map[string][]string) (from, to time.Time, hasRange bool, err error) {
+	fromStr, to1 := firstParam(query, "from"), firstParam(query, "to")
+	if fromStr == "" && to1 == "" {
+		return time.Time{}, time.Time{}, false, nil
+	}
+
+	from, err = time.Parse("2006-01-02", fromStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, fmt.Errorf("参数from格式错误，正确格式为YYYY-MM-DD")
+	}
+	to, err = time.Parse("2006-01-02", to1)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, fmt.Errorf("参数to格式错误，正确格式为YYYY-MM-DD")
+	}
+	return from, to, true, nil
+}
+
+func firstParam(query map[string][]string, key string) string {
+	if values, ok := query[key]; ok && len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// buildExportTV 从缓存重建一份TV文档，按需过滤频道与日期范围
+func buildExportTV(cache *EPGCache, wantChannels map[string]bool, from, to time.Time, hasRange bool) *TV {
+	tv := &TV{
+		GeneratorInfoName: xmltvGeneratorInfoName,
+		SourceInfoURL:     xmltvSourceInfoURL,
+	}
+
+	channelNames := make(map[string][]DisplayName) // 频道ID -> 各语言显示名称
+	for lang, names := range cache.ChannelMaps {
+		for name, id := range names {
+			if wantChannels != nil && !wantChannels[id] {
+				continue
+			}
+			channelNames[id] = append(channelNames[id], DisplayName{Lang: lang, Value: name})
+		}
+	}
+
+	ids := make([]string, 0, len(channelNames))
+	for id := range channelNames {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		tv.Channels = append(tv.Channels, Channel{ID: id, DisplayName: channelNames[id]})
+
+		dates := cache.datesForChannel(id)
+		sort.Strings(dates)
+		for _, date := range dates {
+			if hasRange {
+				d, err := time.Parse("2006-01-02", date)
+				if err != nil || d.Before(from) || d.After(to) {
+					continue
+				}
+			}
+			for _, item := range cache.programsOn(id, date) {
+				tv.Programmes = append(tv.Programmes, programItemToXMLTV(id, item))
+			}
+		}
+	}
+
+	return tv
+}
+
+// programItemToXMLTV 把内部ProgramItem转换回XMLTV的Programme，
+// Start/Stop使用标准的YYYYMMDDHHMMSS ±HHMM格式，保证与原始数据时区一致地往返。
+func programItemToXMLTV(channelID string, item ProgramItem) Programme {
+	prog := Programme{
+		Start:   item.Start.Format("20060102150405 -0700"),
+		Stop:    item.End.Format("20060102150405 -0700"),
+		Channel: channelID,
+		Title:   item.Title,
+
+		SubTitle: item.SubTitle,
+		Desc:     item.Desc,
+		Rating:   item.Rating,
+		Date:     item.Date,
+		Country:  item.Country,
+		Length:   item.Length,
+	}
+	for _, c := range item.Category {
+		prog.Category = append(prog.Category, Category{Value: c})
+	}
+	if item.EpisodeNum != "" {
+		prog.EpisodeNum = []EpisodeNum{{System: "xmltv_ns", Value: item.EpisodeNum}}
+	}
+	prog.Credits.Director = item.Director
+	prog.Credits.Actor = item.Actor
+	if item.Icon != "" {
+		prog.Icon = Icon{Src: item.Icon}
+	}
+	return prog
+}
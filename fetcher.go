@@ -0,0 +1,229 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FetchError 是抓取过程中产生的错误，携带Retryable供调用方判断：
+// Retryable=true表示网络抖动/5xx/429这类瞬时故障，Fetcher内部已经按max_attempts重试过；
+// Retryable=false表示4xx、校验和不匹配、格式不支持等确定性失败，重试到下一次cron tick前都无意义。
+type FetchError struct {
+	Err       error
+	Retryable bool
+}
+
+func (e *FetchError) Error() string { return e.Err.Error() }
+func (e *FetchError) Unwrap() error { return e.Err }
+
+// FetchResult 是一次成功抓取的原始负载与HTTP缓存校验信息
+type FetchResult struct {
+	Body         []byte
+	NotModified  bool
+	ETag         string
+	LastModified string
+}
+
+// Fetcher 负责单个数据源的下载：条件GET、指数退避重试、校验和验证，
+// 具体的解压/格式识别交给detectAndDecompress按魔数处理，不依赖URL或配置里的文件名后缀。
+type Fetcher struct {
+	Client      *http.Client
+	MaxAttempts int
+}
+
+func newFetcher(maxAttempts int) *Fetcher {
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	return &Fetcher{Client: http.DefaultClient, MaxAttempts: maxAttempts}
+}
+
+// fetch 对rawURL发起一次（或多次重试的）条件GET，name仅用于日志标识
+func (f *Fetcher) fetch(name, rawURL string, meta sourceMeta) (*FetchResult, error) {
+	downloadURL, expectedSum := splitChecksumFragment(rawURL)
+
+	var lastErr error
+	for attempt := 1; attempt <= f.MaxAttempts; attempt++ {
+		result, err := f.attempt(name, downloadURL, meta, attempt)
+		if err == nil {
+			if result.NotModified {
+				return result, nil
+			}
+			if expectedSum == "" {
+				expectedSum, _ = fetchSidecarChecksum(f.Client, downloadURL)
+			}
+			if expectedSum != "" {
+				if sumErr := verifyChecksum(result.Body, expectedSum); sumErr != nil {
+					return nil, &FetchError{Err: sumErr, Retryable: false}
+				}
+			}
+			return result, nil
+		}
+
+		fetchErr, _ := err.(*FetchError)
+		if fetchErr != nil && !fetchErr.Retryable {
+			return nil, fetchErr
+		}
+
+		lastErr = err
+		if attempt < f.MaxAttempts {
+			backoff := backoffDuration(attempt)
+			logWarn("[%s] 第%d次下载失败: %v，%s后重试", name, attempt, err, backoff)
+			time.Sleep(backoff)
+		}
+	}
+
+	return nil, &FetchError{Err: fmt.Errorf("重试%d次后仍然失败: %w", f.MaxAttempts, lastErr), Retryable: true}
+}
+
+// attempt 执行单次HTTP请求
+func (f *Fetcher) attempt(name, url string, meta sourceMeta, attemptNo int) (*FetchResult, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, &FetchError{Err: fmt.Errorf("构建请求失败: %w", err), Retryable: false}
+	}
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", meta.LastModified)
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, &FetchError{Err: fmt.Errorf("第%d次请求失败: %w", attemptNo, err), Retryable: true}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		logInfo("[%s] 上游未变化(304)，跳过本次解析", name)
+		return &FetchResult{NotModified: true}, nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, &FetchError{Err: fmt.Errorf("第%d次请求返回状态码%d", attemptNo, resp.StatusCode), Retryable: true}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &FetchError{Err: fmt.Errorf("请求返回状态码%d", resp.StatusCode), Retryable: false}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &FetchError{Err: fmt.Errorf("第%d次读取响应体失败: %w", attemptNo, err), Retryable: true}
+	}
+	logInfo("[%s] 第%d次下载成功，共%d字节", name, attemptNo, len(body))
+
+	return &FetchResult{
+		Body:         body,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// backoffDuration 按尝试次数指数退避并加入随机抖动，避免多个数据源同时失败时的重试风暴
+func backoffDuration(attempt int) time.Duration {
+	base := time.Duration(1<<uint(attempt-1)) * time.Second
+	jitter := time.Duration(rand.Int63n(int64(base)/2 + 1))
+	return base + jitter
+}
+
+// splitChecksumFragment 从URL的#sha256:xxx片段中取出期望的校验和，返回去掉片段后的真实下载地址
+func splitChecksumFragment(rawURL string) (downloadURL, sha256sum string) {
+	idx := strings.Index(rawURL, "#sha256:")
+	if idx < 0 {
+		return rawURL, ""
+	}
+	return rawURL[:idx], rawURL[idx+len("#sha256:"):]
+}
+
+func verifyChecksum(body []byte, expected string) error {
+	sum := sha256.Sum256(body)
+	got := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(got, expected) {
+		return fmt.Errorf("校验和不匹配: 期望%s 实际%s", expected, got)
+	}
+	return nil
+}
+
+// fetchSidecarChecksum 尝试获取<url>.sha256这个sidecar文件，取第一个字段作为期望的sha256值；
+// 不存在sidecar是正常情况，静默忽略即可
+func fetchSidecarChecksum(client *http.Client, downloadURL string) (string, error) {
+	resp, err := client.Get(downloadURL + ".sha256")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("无sidecar校验文件")
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("sidecar校验文件为空")
+	}
+	return fields[0], nil
+}
+
+// detectAndDecompress 按魔数而非文件名探测负载格式：gzip魔数0x1f 0x8b、POSIX tar头部的"ustar"，
+// 否则当作纯文本XML。gzip内部仍可能包裹着tar归档（真正的.tar.gz），因此解压后还会再探测一次——
+// 探测与解包过程对gzip.Reader保持流式读取，这里不会另把整份解压后的文档读入一块缓冲区；
+// 传入的body（压缩后的负载）本身已经完整位于内存中。
+func detectAndDecompress(body []byte) (io.Reader, error) {
+	if len(body) >= 2 && body[0] == 0x1f && body[1] == 0x8b {
+		gzReader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("gzip解压失败: %w", err)
+		}
+		return sniffTar(gzReader)
+	}
+	if looksLikeTar(body) {
+		return extractFirstTarEntry(bytes.NewReader(body))
+	}
+	return bytes.NewReader(body), nil
+}
+
+// sniffTar 用bufio.Reader.Peek窥视开头的字节来判断是否为tar归档，不消费、也不缓冲整个流；
+// Peek过的字节仍留在缓冲区里，后续Read能从头完整读到，流式解包因此不会丢数据。
+func sniffTar(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, 512)
+	peek, _ := br.Peek(262) // 数据不足262字节时Peek会返回较短的切片和一个err，这里只关心内容本身
+	if looksLikeTar(peek) {
+		return extractFirstTarEntry(br)
+	}
+	return br, nil
+}
+
+// looksLikeTar 检查POSIX tar头部偏移257字节处的"ustar"魔数
+func looksLikeTar(data []byte) bool {
+	return len(data) >= 262 && string(data[257:262]) == "ustar"
+}
+
+// extractFirstTarEntry 顺序定位tar归档中的第一个普通文件，返回的reader直接流式读取该文件内容，
+// 不需要把归档或文件内容整个缓冲到内存（archive/tar.Reader本身就是顺序流式解包，无需随机访问）。
+func extractFirstTarEntry(r io.Reader) (io.Reader, error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("tar归档中没有找到文件")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取tar归档失败: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			return tr, nil
+		}
+	}
+}
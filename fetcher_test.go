@@ -0,0 +1,118 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+// TestDetectAndDecompressPlainXML 验证未携带gzip魔数的负载被当作纯文本直接返回
+func TestDetectAndDecompressPlainXML(t *testing.T) {
+	body := []byte(`<tv><channel id="x"/></tv>`)
+	r, err := detectAndDecompress(body)
+	if err != nil {
+		t.Fatalf("detectAndDecompress失败: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("读取结果失败: %v", err)
+	}
+	if string(data) != string(body) {
+		t.Fatalf("期望原样返回，实际为%q", data)
+	}
+}
+
+// TestDetectAndDecompressGzip 验证按gzip魔数(0x1f 0x8b)识别并解压gzip负载
+func TestDetectAndDecompressGzip(t *testing.T) {
+	content := []byte(`<tv><channel id="x"/></tv>`)
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(content); err != nil {
+		t.Fatalf("写入gzip失败: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("关闭gzip writer失败: %v", err)
+	}
+
+	r, err := detectAndDecompress(buf.Bytes())
+	if err != nil {
+		t.Fatalf("detectAndDecompress失败: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("读取结果失败: %v", err)
+	}
+	if string(data) != string(content) {
+		t.Fatalf("期望解压得到%q，实际为%q", content, data)
+	}
+}
+
+// TestDetectAndDecompressTarGz 验证真正的.tar.gz负载（gzip内部是tar归档而非纯XML）
+// 被正确识别并取出第一个文件的内容，而不是把tar头部/块填充当成XML喂给解析器
+func TestDetectAndDecompressTarGz(t *testing.T) {
+	content := []byte(`<tv><channel id="y"/></tv>`)
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	if err := tw.WriteHeader(&tar.Header{Name: "epg.xml", Mode: 0600, Size: int64(len(content))}); err != nil {
+		t.Fatalf("写入tar头部失败: %v", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatalf("写入tar内容失败: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("关闭tar writer失败: %v", err)
+	}
+
+	var gzBuf bytes.Buffer
+	gw := gzip.NewWriter(&gzBuf)
+	if _, err := gw.Write(tarBuf.Bytes()); err != nil {
+		t.Fatalf("写入gzip失败: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("关闭gzip writer失败: %v", err)
+	}
+
+	r, err := detectAndDecompress(gzBuf.Bytes())
+	if err != nil {
+		t.Fatalf("detectAndDecompress失败: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("读取结果失败: %v", err)
+	}
+	if string(data) != string(content) {
+		t.Fatalf("期望取出归档中的文件内容%q，实际为%q", content, data)
+	}
+}
+
+// TestVerifyChecksum 验证sha256校验和匹配与不匹配两种情形
+func TestVerifyChecksum(t *testing.T) {
+	body := []byte("hello epg")
+	sum := sha256.Sum256(body)
+	expected := hex.EncodeToString(sum[:])
+
+	if err := verifyChecksum(body, expected); err != nil {
+		t.Fatalf("校验和应当匹配，却返回错误: %v", err)
+	}
+	if err := verifyChecksum(body, "0000000000000000000000000000000000000000000000000000000000000000"); err == nil {
+		t.Fatal("校验和不匹配时应返回错误")
+	}
+}
+
+// TestSplitChecksumFragment 验证URL上#sha256:片段的拆分
+func TestSplitChecksumFragment(t *testing.T) {
+	url, sum := splitChecksumFragment("http://example.com/e.xml.gz#sha256:abc123")
+	if url != "http://example.com/e.xml.gz" || sum != "abc123" {
+		t.Fatalf("拆分结果不正确: url=%q sum=%q", url, sum)
+	}
+
+	url2, sum2 := splitChecksumFragment("http://example.com/e.xml.gz")
+	if url2 != "http://example.com/e.xml.gz" || sum2 != "" {
+		t.Fatalf("无片段时不应产生校验和: url=%q sum=%q", url2, sum2)
+	}
+}
@@ -1,42 +1,52 @@
 package main
 
 import (
-	"compress/gzip"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/robfig/cron/v3"
 	"gopkg.in/yaml.v3"
 )
 
 // Config 配置文件结构体，对应config.yaml的所有配置项
 type Config struct {
 	Server struct {
-		ListenPort   int    `yaml:"listen_port"`
-		CronSchedule string `yaml:"cron_schedule"`
-		TimeZone     string `yaml:"timezone"`
+		ListenPort int    `yaml:"listen_port"`
+		TimeZone   string `yaml:"timezone"`
 	} `yaml:"server"`
 
+	// Sources 可配置多个EPG数据源，各自独立的抓取周期与优先级
+	Sources []SourceConfig `yaml:"sources"`
+
 	Cache struct {
-		DownloadURL string `yaml:"epg_url"`      // 节目单下载地址
 		DownloadDir string `yaml:"download_dir"` // 本地下载路径
-		CacheFile   string `yaml:"file"`         // 本地缓存路径
+		CacheFile   string `yaml:"file"`          // 本地缓存路径
 	} `yaml:"cache"`
 
 	Log struct {
 		Level string `yaml:"level"` // 日志级别: debug/info/warn/error
 	} `yaml:"log"`
+
+	Fetch struct {
+		MaxAttempts int `yaml:"max_attempts"` // 单次抓取允许的最大重试次数（含首次请求）
+	} `yaml:"fetch"`
+}
+
+// SourceConfig 描述单个EPG数据源
+type SourceConfig struct {
+	Name           string            `yaml:"name"`            // 数据源名称，唯一标识
+	URL            string            `yaml:"url"`             // 下载地址
+	Cron           string            `yaml:"cron"`            // 该数据源的定时抓取表达式
+	Format         string            `yaml:"format"`          // xmltv-gz/xmltv/json
+	Priority       int               `yaml:"priority"`        // 合并冲突时优先级，数值越大越优先
+	ChannelAliases map[string]string `yaml:"channel_aliases"` // 原始频道ID→统一频道ID
 }
 
 const (
@@ -75,38 +85,71 @@ type DisplayName struct {
 }
 
 type Programme struct {
-	Start   string `xml:"start,attr"`
-	Stop    string `xml:"stop,attr"`
-	Channel string `xml:"channel,attr"`
-	Title   string `xml:"title"`
+	Start      string       `xml:"start,attr"`
+	Stop       string       `xml:"stop,attr"`
+	Channel    string       `xml:"channel,attr"`
+	Title      string       `xml:"title"`
+	SubTitle   string       `xml:"sub-title"`
+	Desc       string       `xml:"desc"`
+	Category   []Category   `xml:"category"`
+	EpisodeNum []EpisodeNum `xml:"episode-num"`
+	Credits    Credits      `xml:"credits"`
+	Icon       Icon         `xml:"icon"`
+	Rating     string       `xml:"rating>value"`
+	Date       string       `xml:"date"`
+	Country    string       `xml:"country"`
+	Length     string       `xml:"length"`
 }
 
-// 内存缓存结构
-type EPGCache struct {
-	ChannelMap  map[string]string                   // 频道名称→频道ID
-	ProgramData map[string]map[string][]ProgramItem // 频道ID→日期→节目列表
-	mu          sync.RWMutex
+type Category struct {
+	Lang  string `xml:"lang,attr"`
+	Value string `xml:",chardata"`
+}
+
+type EpisodeNum struct {
+	System string `xml:"system,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type Credits struct {
+	Director []string `xml:"director"`
+	Actor    []string `xml:"actor"`
+}
+
+type Icon struct {
+	Src string `xml:"src,attr"`
 }
 
 type ProgramItem struct {
-	Start string `json:"start"`
-	End   string `json:"end"`
-	Title string `json:"title"`
+	// Start/End保留完整的time.Time（含原始时区），而非只取HH:MM，
+	// 这样跨日的节目、重新导出XMLTV、以及now/next查询都不会丢失日期与时区信息。
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Title      string    `json:"title"`
+	SubTitle   string    `json:"sub_title,omitempty"`
+	Desc       string    `json:"desc,omitempty"`
+	Category   []string  `json:"category,omitempty"`
+	EpisodeNum string    `json:"episode_num,omitempty"`
+	Director   []string  `json:"director,omitempty"`
+	Actor      []string  `json:"actor,omitempty"`
+	Icon       string    `json:"icon,omitempty"`
+	Rating     string    `json:"rating,omitempty"`
+	Date       string    `json:"date,omitempty"`
+	Country    string    `json:"country,omitempty"`
+	Length     string    `json:"length,omitempty"`
 }
 
 // 接口返回结构
 type EPGResponse struct {
 	ChannelName string        `json:"channel_name"`
-	Date        string        `json:"date"`
+	Date        string        `json:"date,omitempty"`
+	From        string        `json:"from,omitempty"`
+	To          string        `json:"to,omitempty"`
 	EPGData     []ProgramItem `json:"epg_data"`
 }
 
-var (
-	epgCache = &EPGCache{
-		ChannelMap:  make(map[string]string),
-		ProgramData: make(map[string]map[string][]ProgramItem),
-	}
-)
+// defaultLang 未指定lang参数时使用的显示语言
+const defaultLang = "zh"
 
 // 初始化日志
 func initLogger() {
@@ -161,17 +204,32 @@ func setDefaultConfig() {
 	if config.Server.ListenPort == 0 {
 		config.Server.ListenPort = 8090
 	}
-	if config.Server.CronSchedule == "" {
-		config.Server.CronSchedule = "0 0 * * *"
-	}
 	if config.Server.TimeZone == "" {
 		config.Server.TimeZone = "Asia/Shanghai"
 	}
 
-	// Cache默认值
-	if config.Cache.DownloadURL == "" {
-		config.Cache.DownloadURL = "http://epg.51zmt.top:8000/e.xml.gz"
+	// Sources默认值：未配置任何数据源时，回退到旧版本的单一默认数据源
+	if len(config.Sources) == 0 {
+		config.Sources = []SourceConfig{
+			{
+				Name:     "default",
+				URL:      "http://epg.51zmt.top:8000/e.xml.gz",
+				Cron:     "0 0 * * *",
+				Format:   "xmltv-gz",
+				Priority: 0,
+			},
+		}
+	}
+	for i := range config.Sources {
+		if config.Sources[i].Cron == "" {
+			config.Sources[i].Cron = "0 0 * * *"
+		}
+		if config.Sources[i].Format == "" {
+			config.Sources[i].Format = "xmltv-gz"
+		}
 	}
+
+	// Cache默认值
 	if config.Cache.DownloadDir == "" {
 		config.Cache.DownloadDir = "./epg_download"
 	}
@@ -179,6 +237,11 @@ func setDefaultConfig() {
 		config.Cache.CacheFile = "./epg_cache.json"
 	}
 
+	// Fetch默认值
+	if config.Fetch.MaxAttempts <= 0 {
+		config.Fetch.MaxAttempts = 3
+	}
+
 	// Log默认值
 	if config.Log.Level == "" {
 		config.Log.Level = LogLevelInfo
@@ -210,33 +273,38 @@ func main() {
 	}
 
 	// 加载缓存（如果存在）
+	needInitialFetch := false
 	if err := loadCache(); err != nil {
 		logWarn("加载缓存失败: %v 将重新下载", err)
-		// 首次运行立即执行一次下载
-		if err := downloadAndParseEPG(); err != nil {
-			logError("首次下载解析失败: %v", err)
-		}
+		needInitialFetch = true
 	}
 
-	// 启动定时任务
-	c := cron.New(cron.WithLocation(loc))
-	_, err = c.AddFunc(config.Server.CronSchedule, func() {
-		logInfo("开始执行每日EPG更新任务")
-		if err := downloadAndParseEPG(); err != nil {
-			logError("定时任务执行失败: %v", err)
-		} else {
-			logInfo("定时任务执行成功")
-		}
-	})
-	if err != nil {
-		logError("创建定时任务失败: %v", err)
+	// 恢复各数据源上一次成功抓取的快照，避免重启后某个数据源命中304而长期无法参与合并
+	restoreSourceDataCache()
+
+	// 启动订阅管理器：为每个数据源注册独立的定时任务
+	subscriptionMgr = newSubscriptionManager(loc)
+	if err := subscriptionMgr.start(); err != nil {
+		logError("启动订阅管理器失败: %v", err)
 		return
 	}
-	c.Start()
-	defer c.Stop()
+	defer subscriptionMgr.stop()
+
+	if needInitialFetch {
+		// 首次运行立即拉取一遍所有数据源
+		subscriptionMgr.runAll()
+	}
 
 	// 注册HTTP处理函数
 	http.HandleFunc("/", epgQueryHandler)
+	http.HandleFunc("/admin/sources", adminSourcesHandler)
+	http.HandleFunc("/admin/sources/", adminSourceRunHandler)
+	http.HandleFunc("/admin/reload", adminReloadHandler)
+	http.HandleFunc("/xmltv.xml", xmltvExportHandler)
+	http.HandleFunc("/xmltv.xml.gz", xmltvExportHandler)
+	http.HandleFunc("/now", nowHandler)
+	http.HandleFunc("/next", nextHandler)
+	http.HandleFunc("/at", atHandler)
 
 	// 启动HTTP服务
 	logInfo("EPG服务已启动，监听端口: %d", config.Server.ListenPort)
@@ -253,229 +321,170 @@ func initDirs() error {
 	return nil
 }
 
-// 下载并解析EPG数据
-func downloadAndParseEPG() error {
-	// 1. 下载gz文件
-	logInfo("开始下载EPG文件...")
-	tmpFile, err := downloadFile(config.Cache.DownloadURL)
-	if err != nil {
-		return fmt.Errorf("下载失败: %w", err)
-	}
-	defer os.Remove(tmpFile) // 下载完成后删除临时文件
-
-	// 2. 解压文件
-	logInfo("开始解压EPG文件...")
-	xmlFilePath, err := extractTarGz(tmpFile, config.Cache.DownloadDir)
-	if err != nil {
-		return fmt.Errorf("解压失败: %w", err)
-	}
-
-	// 3. 解析XML文件
-	logInfo("开始解析XML文件...")
-	tvData, err := parseEPGXML(xmlFilePath)
-	if err != nil {
-		return fmt.Errorf("解析XML失败: %w", err)
-	}
-
-	// 4. 构建缓存
-	logInfo("开始构建EPG缓存...")
-	if err := buildEPGCache(tvData); err != nil {
-		return fmt.Errorf("构建缓存失败: %w", err)
-	}
-
-	// 5. 保存缓存到文件
-	logInfo("保存EPG缓存到文件...")
-	if err := saveCache(); err != nil {
-		return fmt.Errorf("保存缓存失败: %w", err)
-	}
-
-	return nil
+// sourceTV 关联一个数据源的优先级与其解析出的XMLTV数据，供buildEPGCache合并
+type sourceTV struct {
+	name     string
+	priority int
+	tv       *TV
 }
 
-// 下载文件到临时路径
-func downloadFile(url string) (string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP请求失败，状态码: %d", resp.StatusCode)
-	}
-
-	// 创建临时文件
-	tmpFile, err := os.CreateTemp(config.Cache.DownloadDir, "epg_*.gz")
-	if err != nil {
-		return "", err
-	}
-	defer tmpFile.Close()
+// buildEPGCache 合并多个数据源的数据，构建一份全新的EPG缓存并原子替换当前对外提供服务的缓存。
+// 频道名称映射按数据源遍历顺序写入（后面的数据源可覆盖同名频道）；
+// 节目数据在(channel, start, title)冲突时（start按绝对时刻比较，与各数据源的时区偏移无关）保留priority更高（数值更大）的数据源，
+// priority相同时按数据源名称排序取靠前者，确保合并结果与调用方传入sources的遍历顺序无关。
+// 整个过程只操作未发布的shadow缓存，构建期间查询流量仍然由旧缓存提供服务，互不阻塞。
+func buildEPGCache(sources []sourceTV) error {
+	// sources可能来自对map的遍历（顺序随机），先按名称排序使合并结果确定、可复现
+	sources = append([]sourceTV(nil), sources...)
+	sort.Slice(sources, func(i, j int) bool { return sources[i].name < sources[j].name })
+
+	shadow := newEPGCache()
+
+	type mergedItem struct {
+		channel  string
+		date     string
+		priority int
+		item     ProgramItem
+	}
+	merged := make(map[string]*mergedItem)
+
+	for _, src := range sources {
+		// 1. 构建各语言的 频道名称→ID 映射
+		for _, ch := range src.tv.Channels {
+			for _, dn := range ch.DisplayName {
+				if dn.Value == "" {
+					continue
+				}
+				lang := dn.Lang
+				if lang == "" {
+					lang = defaultLang
+				}
+				if shadow.ChannelMaps[lang] == nil {
+					shadow.ChannelMaps[lang] = make(map[string]string)
+				}
+				shadow.ChannelMaps[lang][dn.Value] = ch.ID
+			}
+		}
 
-	// 写入文件
-	_, err = io.Copy(tmpFile, resp.Body)
-	if err != nil {
-		return "", err
-	}
+		// 2. 处理节目数据
+		for _, prog := range src.tv.Programmes {
+			// 解析开始时间
+			startTime, err := parseEPGTime(prog.Start)
+			if err != nil {
+				logWarn("[%s] 解析开始时间失败: %v, 跳过该节目", src.name, err)
+				continue
+			}
 
-	return tmpFile.Name(), nil
-}
+			// 解析结束时间
+			stopTime, err := parseEPGTime(prog.Stop)
+			if err != nil {
+				logWarn("[%s] 解析结束时间失败: %v, 跳过该节目", src.name, err)
+				continue
+			}
 
-// 解压tar.gz文件
-func extractTarGz(gzPath, destDir string) (string, error) {
-	file, err := os.Open(gzPath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
+			// 格式化日期（YYYY-MM-DD），用于按天分桶
+			dateStr := startTime.Format("2006-01-02")
 
-	// 解压缩gzip
-	gzReader, err := gzip.NewReader(file)
-	if err != nil {
-		return "", err
-	}
-	defer gzReader.Close()
+			dedupeKey := strings.Join([]string{prog.Channel, startTime.UTC().Format(time.RFC3339), prog.Title}, "|")
+			if existing, ok := merged[dedupeKey]; ok && existing.priority >= src.priority {
+				// 已有优先级更高（或相同）的数据源提供了该节目，跳过
+				continue
+			}
 
-	// 获取原始文件名（去掉.gz后缀）
-	baseName := filepath.Base(gzPath)
-	xmlFileName := strings.TrimSuffix(baseName, ".gz")
-	if !strings.HasSuffix(strings.ToLower(xmlFileName), ".xml") {
-		// 如果去掉.gz后不是xml，自动补充.xml后缀
-		xmlFileName += ".xml"
+			// 构建节目项（保留XMLTV的扩展字段，供查询/导出使用）
+			merged[dedupeKey] = &mergedItem{
+				channel:  prog.Channel,
+				date:     dateStr,
+				priority: src.priority,
+				item: ProgramItem{
+					Start:      startTime,
+					End:        stopTime,
+					Title:      prog.Title,
+					SubTitle:   prog.SubTitle,
+					Desc:       prog.Desc,
+					Category:   categoryValues(prog.Category),
+					EpisodeNum: firstEpisodeNum(prog.EpisodeNum),
+					Director:   prog.Credits.Director,
+					Actor:      prog.Credits.Actor,
+					Icon:       prog.Icon.Src,
+					Rating:     prog.Rating,
+					Date:       prog.Date,
+					Country:    prog.Country,
+					Length:     prog.Length,
+				},
+			}
+		}
 	}
 
-	// 构建目标路径
-	targetPath := filepath.Join(destDir, xmlFileName)
-
-	// 创建XML文件并写入解压内容
-	outFile, err := os.Create(targetPath)
-	if err != nil {
-		return "", err
+	for _, mi := range merged {
+		shadow.addProgram(mi.channel, mi.date, mi.item)
 	}
-	defer outFile.Close()
+	shadow.finalizeIndex()
 
-	_, err = io.Copy(outFile, gzReader)
-	if err != nil {
-		return "", err
-	}
+	// 构建完成，原子替换当前缓存
+	epgCache.Store(shadow)
 
-	return targetPath, nil
+	return nil
 }
 
-// 解析EPG XML文件
-func parseEPGXML(xmlPath string) (*TV, error) {
-	file, err := os.Open(xmlPath)
-	if err != nil {
-		return nil, err
+// categoryValues 取出category元素的文本内容（忽略lang，保留原始顺序）
+func categoryValues(categories []Category) []string {
+	if len(categories) == 0 {
+		return nil
 	}
-	defer file.Close()
-
-	// 解析XML
-	var tv TV
-	decoder := xml.NewDecoder(file)
-	if err := decoder.Decode(&tv); err != nil {
-		return nil, err
+	values := make([]string, 0, len(categories))
+	for _, c := range categories {
+		if c.Value != "" {
+			values = append(values, c.Value)
+		}
 	}
-
-	return &tv, nil
+	return values
 }
 
-// 构建EPG缓存
-func buildEPGCache(tv *TV) error {
-	epgCache.mu.Lock()
-	defer epgCache.mu.Unlock()
-
-	// 清空旧数据
-	epgCache.ChannelMap = make(map[string]string)
-	epgCache.ProgramData = make(map[string]map[string][]ProgramItem)
-
-	// 1. 构建频道名称→ID映射
-	for _, ch := range tv.Channels {
-		// 只取中文名称
-		for _, dn := range ch.DisplayName {
-			if dn.Lang == "zh" && dn.Value != "" {
-				epgCache.ChannelMap[dn.Value] = ch.ID
-				break
-			}
+// firstEpisodeNum 取第一个episode-num值，优先xmltv_ns系统
+func firstEpisodeNum(nums []EpisodeNum) string {
+	for _, n := range nums {
+		if n.System == "xmltv_ns" {
+			return n.Value
 		}
 	}
-
-	// 2. 处理节目数据
-	for _, prog := range tv.Programmes {
-		// 解析开始时间
-		startTime, err := parseEPGTime(prog.Start)
-		if err != nil {
-			logWarn("解析开始时间失败: %v, 跳过该节目", err)
-			continue
-		}
-
-		// 解析结束时间
-		stopTime, err := parseEPGTime(prog.Stop)
-		if err != nil {
-			logWarn("解析结束时间失败: %v, 跳过该节目", err)
-			continue
-		}
-
-		// 格式化日期（YYYY-MM-DD）
-		dateStr := startTime.Format("2006-01-02")
-
-		// 格式化时间（HH:MM）
-		startStr := startTime.Format("15:04")
-		stopStr := stopTime.Format("15:04")
-
-		// 构建节目项
-		item := ProgramItem{
-			Start: startStr,
-			End:   stopStr,
-			Title: prog.Title,
-		}
-
-		// 初始化层级结构
-		if _, ok := epgCache.ProgramData[prog.Channel]; !ok {
-			epgCache.ProgramData[prog.Channel] = make(map[string][]ProgramItem)
-		}
-		if _, ok := epgCache.ProgramData[prog.Channel][dateStr]; !ok {
-			epgCache.ProgramData[prog.Channel][dateStr] = make([]ProgramItem, 0)
-		}
-
-		// 添加节目
-		epgCache.ProgramData[prog.Channel][dateStr] = append(epgCache.ProgramData[prog.Channel][dateStr], item)
+	if len(nums) > 0 {
+		return nums[0].Value
 	}
-
-	return nil
+	return ""
 }
 
-// 解析EPG时间格式（如：20260212010400 +0800）
+// 解析EPG时间格式（如：20260212010400 +0800）。
+// 必须用time.Parse吃掉字符串自带的±hhmm偏移来构建绝对时刻——
+// 喂给time.Date的只有年月日时分秒这些挂钟数字，若像早期实现那样固定套用
+// time.Local（即config.Server.TimeZone），对于偏移与服务器时区不同的数据源，
+// 解析出来的瞬间就会整整偏差一个时区差，导致now/next判断和导出时间都是错的。
 func parseEPGTime(timeStr string) (time.Time, error) {
-	// 分割时间和时区
-	parts := strings.Split(timeStr, " ")
-	if len(parts) < 1 {
-		return time.Time{}, errors.New("无效的时间格式")
-	}
-
-	// 解析时间部分（YYYYMMDDHHMMSS）
-	baseTime := parts[0]
-	if len(baseTime) != 14 {
+	timeStr = strings.TrimSpace(timeStr)
+	if len(timeStr) < 14 {
 		return time.Time{}, errors.New("时间格式长度不正确")
 	}
 
-	year, _ := strconv.Atoi(baseTime[0:4])
-	month, _ := strconv.Atoi(baseTime[4:6])
-	day, _ := strconv.Atoi(baseTime[6:8])
-	hour, _ := strconv.Atoi(baseTime[8:10])
-	minute, _ := strconv.Atoi(baseTime[10:12])
-	second, _ := strconv.Atoi(baseTime[12:14])
+	if len(timeStr) > 14 {
+		// 形如"20260212010400 +0800"，自带时区偏移
+		t, err := time.Parse("20060102150405 -0700", timeStr)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("解析时间失败: %w", err)
+		}
+		return t, nil
+	}
 
-	// 构建时间
-	t := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.Local)
+	// 未携带时区偏移，按服务器配置的时区解释挂钟时间
+	t, err := time.ParseInLocation("20060102150405", timeStr, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("解析时间失败: %w", err)
+	}
 	return t, nil
 }
 
 // 保存缓存到文件
 func saveCache() error {
-	epgCache.mu.RLock()
-	defer epgCache.mu.RUnlock()
-
-	data, err := json.Marshal(epgCache)
+	data, err := json.Marshal(epgCache.Load())
 	if err != nil {
 		return err
 	}
@@ -494,71 +503,128 @@ func loadCache() error {
 		return err
 	}
 
-	epgCache.mu.Lock()
-	defer epgCache.mu.Unlock()
-
-	return json.Unmarshal(data, epgCache)
+	cache := newEPGCache()
+	if err := json.Unmarshal(data, cache); err != nil {
+		return err
+	}
+	epgCache.Store(cache)
+	return nil
 }
 
 // HTTP请求处理函数
+// 支持的查询参数：
+//   ch     频道名称（必填）
+//   lang   显示语言，决定按哪个ChannelMap解析ch，默认zh
+//   date   单日查询，格式YYYY-MM-DD
+//   from/to 日期范围查询（含两端），格式YYYY-MM-DD，与date二选一
+//   genre  按category过滤（精确匹配任意一个category值）
+//   q      按title/desc做子串全文匹配
 func epgQueryHandler(w http.ResponseWriter, r *http.Request) {
 	logDebug("收到请求: %s %s", r.RemoteAddr, r.RequestURI)
 
 	// 设置响应头
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	// 解析参数
-	chName := r.URL.Query().Get("ch")
-	dateStr := r.URL.Query().Get("date")
+	query := r.URL.Query()
+	chName := query.Get("ch")
+	lang := query.Get("lang")
+	if lang == "" {
+		lang = defaultLang
+	}
+	dateStr := query.Get("date")
+	fromStr := query.Get("from")
+	toStr := query.Get("to")
+	genre := query.Get("genre")
+	q := strings.ToLower(query.Get("q"))
+
+	if chName == "" {
+		writeJSONError(w, "参数缺失，必须提供ch参数")
+		return
+	}
 
-	// 参数校验
-	if chName == "" || dateStr == "" {
-		errResp := map[string]string{"error": "参数缺失，必须提供ch和date参数"}
-		json.NewEncoder(w).Encode(errResp)
+	if dateStr != "" {
+		fromStr, toStr = dateStr, dateStr
+	}
+	if fromStr == "" || toStr == "" {
+		writeJSONError(w, "参数缺失，必须提供date或from/to参数")
 		return
 	}
 
-	// 验证日期格式
-	if _, err := time.Parse("2006-01-02", dateStr); err != nil {
-		errResp := map[string]string{"error": "日期格式错误，正确格式为YYYY-MM-DD"}
-		json.NewEncoder(w).Encode(errResp)
+	from, err := time.Parse("2006-01-02", fromStr)
+	if err != nil {
+		writeJSONError(w, "日期格式错误，正确格式为YYYY-MM-DD")
+		return
+	}
+	to, err := time.Parse("2006-01-02", toStr)
+	if err != nil {
+		writeJSONError(w, "日期格式错误，正确格式为YYYY-MM-DD")
+		return
+	}
+	if to.Before(from) {
+		writeJSONError(w, "from不能晚于to")
 		return
 	}
 
-	// 查询缓存
-	epgCache.mu.RLock()
-	defer epgCache.mu.RUnlock()
+	// 查询缓存（读取的是当前已发布的快照，不会被后台重建阻塞）
+	cache := epgCache.Load()
 
-	// 获取频道ID
-	chID, ok := epgCache.ChannelMap[chName]
+	// 获取频道ID（按指定语言解析频道名称）
+	chMap, ok := cache.ChannelMaps[lang]
 	if !ok {
-		errResp := map[string]string{"error": fmt.Sprintf("未找到频道: %s", chName)}
-		json.NewEncoder(w).Encode(errResp)
+		writeJSONError(w, fmt.Sprintf("不支持的语言: %s", lang))
 		return
 	}
-
-	// 获取节目数据
-	datePrograms, ok := epgCache.ProgramData[chID]
+	chID, ok := chMap[chName]
 	if !ok {
-		errResp := map[string]string{"error": fmt.Sprintf("频道%s暂无节目数据", chName)}
-		json.NewEncoder(w).Encode(errResp)
+		writeJSONError(w, fmt.Sprintf("未找到频道: %s", chName))
 		return
 	}
 
-	programs, ok := datePrograms[dateStr]
-	if !ok {
-		errResp := map[string]string{"error": fmt.Sprintf("频道%s在%s暂无节目数据", chName, dateStr)}
-		json.NewEncoder(w).Encode(errResp)
+	if !cache.hasChannel(chID) {
+		writeJSONError(w, fmt.Sprintf("频道%s暂无节目数据", chName))
 		return
 	}
 
+	// 汇总日期范围内的节目，并按genre/q过滤
+	var epgData []ProgramItem
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		for _, item := range cache.programsOn(chID, d.Format("2006-01-02")) {
+			if genre != "" && !containsString(item.Category, genre) {
+				continue
+			}
+			if q != "" && !strings.Contains(strings.ToLower(item.Title), q) && !strings.Contains(strings.ToLower(item.Desc), q) {
+				continue
+			}
+			epgData = append(epgData, item)
+		}
+	}
+
 	// 构建响应
 	resp := EPGResponse{
 		ChannelName: chName,
-		Date:        dateStr,
-		EPGData:     programs,
+		From:        fromStr,
+		To:          toStr,
+		EPGData:     epgData,
+	}
+	if dateStr != "" {
+		resp.Date = dateStr
 	}
 
 	// 返回结果
 	json.NewEncoder(w).Encode(resp)
 }
+
+// writeJSONError 统一输出错误响应
+func writeJSONError(w http.ResponseWriter, msg string) {
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// containsString 判断slice中是否存在目标字符串
+func containsString(list []string, target string) bool {
+	for _, v := range list {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func tvWithProgramme(channelID, desc string) *TV {
+	return &TV{
+		Channels: []Channel{{ID: channelID, DisplayName: []DisplayName{{Lang: "zh", Value: channelID}}}},
+		Programmes: []Programme{{
+			Start:   "20260212010000 +0000",
+			Stop:    "20260212020000 +0000",
+			Channel: channelID,
+			Title:   "News",
+			Desc:    desc,
+		}},
+	}
+}
+
+// TestBuildEPGCacheDedupeKeepsHigherPriority 验证(channel, start, title)冲突时
+// 合并结果保留priority更高的数据源，而不是先到先得
+func TestBuildEPGCacheDedupeKeepsHigherPriority(t *testing.T) {
+	sources := []sourceTV{
+		{name: "low", priority: 1, tv: tvWithProgramme("cctv1", "low priority desc")},
+		{name: "high", priority: 5, tv: tvWithProgramme("cctv1", "high priority desc")},
+	}
+
+	if err := buildEPGCache(sources); err != nil {
+		t.Fatalf("buildEPGCache失败: %v", err)
+	}
+
+	items := epgCache.Load().programsOn("cctv1", "2026-02-12")
+	if len(items) != 1 {
+		t.Fatalf("期望去重后只剩1条节目，实际%d条", len(items))
+	}
+	if items[0].Desc != "high priority desc" {
+		t.Errorf("期望保留高优先级数据源的节目，实际为%q", items[0].Desc)
+	}
+}
+
+// TestBuildEPGCacheTieBreakIsDeterministic 验证priority相同时，合并结果与
+// 调用方传入sources的顺序无关（sourceDataCache来自map遍历，顺序本身是随机的）
+func TestBuildEPGCacheTieBreakIsDeterministic(t *testing.T) {
+	orderA := []sourceTV{
+		{name: "zeta", priority: 1, tv: tvWithProgramme("cctv1", "zeta desc")},
+		{name: "alpha", priority: 1, tv: tvWithProgramme("cctv1", "alpha desc")},
+	}
+	orderB := []sourceTV{
+		{name: "alpha", priority: 1, tv: tvWithProgramme("cctv1", "alpha desc")},
+		{name: "zeta", priority: 1, tv: tvWithProgramme("cctv1", "zeta desc")},
+	}
+
+	if err := buildEPGCache(orderA); err != nil {
+		t.Fatalf("buildEPGCache失败: %v", err)
+	}
+	itemsA := epgCache.Load().programsOn("cctv1", "2026-02-12")
+
+	if err := buildEPGCache(orderB); err != nil {
+		t.Fatalf("buildEPGCache失败: %v", err)
+	}
+	itemsB := epgCache.Load().programsOn("cctv1", "2026-02-12")
+
+	if len(itemsA) != 1 || len(itemsB) != 1 {
+		t.Fatalf("期望去重后各剩1条节目，实际%d和%d条", len(itemsA), len(itemsB))
+	}
+	if itemsA[0].Desc != itemsB[0].Desc {
+		t.Fatalf("相同优先级的平局结果应与传入顺序无关，实际为%q和%q", itemsA[0].Desc, itemsB[0].Desc)
+	}
+	if itemsA[0].Desc != "alpha desc" {
+		t.Errorf("期望按名称排序取靠前者(alpha)，实际为%q", itemsA[0].Desc)
+	}
+}
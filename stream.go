@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// decodeXMLTVStream 逐个token遍历XMLTV文档，只在遇到<channel>/<programme>起始标签时才DecodeElement单个元素。
+// 解析出的全部频道与节目都会追加进返回的TV中，因此整份文档的数据最终仍完整保存在内存里。
+func decodeXMLTVStream(r io.Reader) (*TV, error) {
+	decoder := xml.NewDecoder(r)
+	tv := &TV{}
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取XML token失败: %w", err)
+		}
+
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch se.Name.Local {
+		case "tv":
+			for _, attr := range se.Attr {
+				switch attr.Name.Local {
+				case "generator-info-name":
+					tv.GeneratorInfoName = attr.Value
+				case "generator-info-url":
+					tv.GeneratorInfoURL = attr.Value
+				case "source-info-name":
+					tv.SourceInfoName = attr.Value
+				case "source-info-url":
+					tv.SourceInfoURL = attr.Value
+				}
+			}
+		case "channel":
+			var ch Channel
+			if err := decoder.DecodeElement(&ch, &se); err != nil {
+				return nil, fmt.Errorf("解析channel元素失败: %w", err)
+			}
+			tv.Channels = append(tv.Channels, ch)
+		case "programme":
+			var prog Programme
+			if err := decoder.DecodeElement(&prog, &se); err != nil {
+				return nil, fmt.Errorf("解析programme元素失败: %w", err)
+			}
+			tv.Programmes = append(tv.Programmes, prog)
+		}
+	}
+
+	return tv, nil
+}
+
+// sourceMeta 记录一个数据源上一次成功抓取时的HTTP缓存校验信息
+type sourceMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func sourceMetaPath(name string) string {
+	return filepath.Join(config.Cache.DownloadDir, name+".meta.json")
+}
+
+func loadSourceMeta(name string) sourceMeta {
+	data, err := os.ReadFile(sourceMetaPath(name))
+	if err != nil {
+		return sourceMeta{}
+	}
+	var meta sourceMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return sourceMeta{}
+	}
+	return meta
+}
+
+func saveSourceMeta(name string, meta sourceMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sourceMetaPath(name), data, 0644)
+}
+
+func sourceSnapshotPath(name string) string {
+	return filepath.Join(config.Cache.DownloadDir, name+".snapshot.json")
+}
+
+// saveSourceSnapshot 把一个数据源解析成功后的完整XMLTV数据落盘，
+// 使sourceDataCache能在进程重启后恢复，而不必依赖每个数据源重新触发一次非304的真实抓取。
+func saveSourceSnapshot(name string, tv *TV) error {
+	data, err := json.Marshal(tv)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sourceSnapshotPath(name), data, 0644)
+}
+
+// loadSourceSnapshot 恢复一个数据源上一次落盘的XMLTV数据；快照不存在或已损坏时返回ok=false
+func loadSourceSnapshot(name string) (tv *TV, ok bool) {
+	data, err := os.ReadFile(sourceSnapshotPath(name))
+	if err != nil {
+		return nil, false
+	}
+	var parsed TV
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, false
+	}
+	return &parsed, true
+}
+
+// fetchSourceTV 通过Fetcher下载单个数据源（条件GET+重试退避+校验和校验），
+// 再按魔数自动识别负载格式并流式解析为XMLTV，不在磁盘上落地中间.xml文件。
+// 若上游返回304 Not Modified则直接返回notModified=true，调用方应跳过本次合并重建。
+func fetchSourceTV(src SourceConfig) (tv *TV, notModified bool, err error) {
+	if src.Format == "json" {
+		return nil, false, &FetchError{Err: fmt.Errorf("数据源[%s]: 暂不支持json格式", src.Name), Retryable: false}
+	}
+
+	logInfo("[%s] 开始下载EPG文件: %s", src.Name, src.URL)
+
+	fetcher := newFetcher(config.Fetch.MaxAttempts)
+	meta := loadSourceMeta(src.Name)
+	result, err := fetcher.fetch(src.Name, src.URL, meta)
+	if err != nil {
+		return nil, false, err
+	}
+	if result.NotModified {
+		return nil, true, nil
+	}
+
+	reader, err := detectAndDecompress(result.Body)
+	if err != nil {
+		return nil, false, &FetchError{Err: fmt.Errorf("数据源[%s]: %w", src.Name, err), Retryable: false}
+	}
+
+	logInfo("[%s] 开始流式解析XML...", src.Name)
+	tv, err = decodeXMLTVStream(reader)
+	if err != nil {
+		return nil, false, &FetchError{Err: fmt.Errorf("解析XML失败: %w", err), Retryable: false}
+	}
+
+	newMeta := sourceMeta{ETag: result.ETag, LastModified: result.LastModified}
+	if err := saveSourceMeta(src.Name, newMeta); err != nil {
+		logWarn("[%s] 保存缓存校验信息失败: %v", src.Name, err)
+	}
+
+	return tv, false, nil
+}
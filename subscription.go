@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// retrySoonDelay 是数据源抓取遇到Retryable错误（网络抖动/5xx/429，Fetcher内部已按
+// max_attempts重试过仍未成功）时，在等待下一次cron tick之前额外安排的一次重试延迟。
+const retrySoonDelay = 30 * time.Second
+
+// SourceStatus 记录单个数据源最近一次抓取的执行状态，供/admin/sources展示
+type SourceStatus struct {
+	Name    string    `json:"name"`
+	Running bool      `json:"running"`
+	LastRun time.Time `json:"last_run,omitempty"`
+	LastErr string    `json:"last_error,omitempty"`
+	NextRun time.Time `json:"next_run,omitempty"`
+}
+
+// SubscriptionManager 管理多个EPG数据源：为每个数据源注册独立的cron任务，
+// 下载解析后合并进全局epgCache，并对外提供管理端点用于手动触发与热加载配置。
+type SubscriptionManager struct {
+	mu      sync.RWMutex
+	cronSvc *cron.Cron
+	entries map[string]cron.EntryID
+	status  map[string]*SourceStatus
+}
+
+func newSubscriptionManager(loc *time.Location) *SubscriptionManager {
+	return &SubscriptionManager{
+		cronSvc: cron.New(cron.WithLocation(loc)),
+		entries: make(map[string]cron.EntryID),
+		status:  make(map[string]*SourceStatus),
+	}
+}
+
+// start 为当前配置中的每个数据源注册定时任务并启动调度器
+func (m *SubscriptionManager) start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, src := range config.Sources {
+		src := src
+		m.status[src.Name] = &SourceStatus{Name: src.Name}
+		entryID, err := m.cronSvc.AddFunc(src.Cron, func() {
+			m.runSource(src)
+		})
+		if err != nil {
+			return fmt.Errorf("注册数据源[%s]的定时任务失败: %w", src.Name, err)
+		}
+		m.entries[src.Name] = entryID
+	}
+	m.cronSvc.Start()
+	return nil
+}
+
+func (m *SubscriptionManager) stop() {
+	m.cronSvc.Stop()
+}
+
+// runAll 立即触发一次所有数据源的抓取，用于首次启动时没有可用缓存的场景
+func (m *SubscriptionManager) runAll() {
+	for _, src := range config.Sources {
+		m.runSource(src)
+	}
+}
+
+// runSource 下载并解析单个数据源，然后合并进全局缓存。
+// 若失败被Fetcher归类为Retryable（瞬时故障，已在Fetcher内部按max_attempts重试过仍未成功），
+// 额外安排一次retrySoonDelay之后的重试，而不是放任它一直等到下一次cron tick；
+// 非Retryable的失败（4xx、校验和不匹配、格式不支持等）重试没有意义，只记录并等待下次调度。
+func (m *SubscriptionManager) runSource(src SourceConfig) {
+	m.mu.Lock()
+	st := m.status[src.Name]
+	if st == nil {
+		st = &SourceStatus{Name: src.Name}
+		m.status[src.Name] = st
+	}
+	st.Running = true
+	m.mu.Unlock()
+
+	logInfo("开始执行数据源[%s]的更新任务", src.Name)
+	err := refreshSource(src)
+
+	m.mu.Lock()
+	st.Running = false
+	st.LastRun = time.Now()
+	if err != nil {
+		st.LastErr = err.Error()
+		logError("数据源[%s]更新失败: %v", src.Name, err)
+	} else {
+		st.LastErr = ""
+		logInfo("数据源[%s]更新成功", src.Name)
+	}
+	if entryID, ok := m.entries[src.Name]; ok {
+		st.NextRun = m.cronSvc.Entry(entryID).Next
+	}
+	m.mu.Unlock()
+
+	var fetchErr *FetchError
+	if err != nil && errors.As(err, &fetchErr) && fetchErr.Retryable {
+		logWarn("数据源[%s]的失败可重试，%s后将额外尝试一次，不必等到下一次定时任务", src.Name, retrySoonDelay)
+		time.AfterFunc(retrySoonDelay, func() {
+			m.runSource(src)
+		})
+	}
+}
+
+// runByName 按名称手动触发一个数据源的抓取，供POST /admin/sources/{name}/run 使用
+func (m *SubscriptionManager) runByName(name string) error {
+	for _, src := range config.Sources {
+		if src.Name == name {
+			go m.runSource(src)
+			return nil
+		}
+	}
+	return fmt.Errorf("未找到数据源: %s", name)
+}
+
+// snapshot 返回当前所有数据源的状态快照
+func (m *SubscriptionManager) snapshot() []*SourceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]*SourceStatus, 0, len(config.Sources))
+	for _, src := range config.Sources {
+		if st, ok := m.status[src.Name]; ok {
+			copied := *st
+			list = append(list, &copied)
+		}
+	}
+	return list
+}
+
+// reload 重新加载YAML配置，重建所有cron任务，无需重启进程；
+// 从sources中被删除的数据源不会再被refreshSource触碰，因此这里显式地把它们的
+// 残留数据从sourceDataCache中清理掉并重建一次缓存，否则会被永久合并进每次重建。
+func (m *SubscriptionManager) reload() error {
+	oldNames := make(map[string]bool, len(config.Sources))
+	for _, src := range config.Sources {
+		oldNames[src.Name] = true
+	}
+
+	if err := loadConfig(configFile); err != nil {
+		return err
+	}
+
+	newNames := make(map[string]bool, len(config.Sources))
+	for _, src := range config.Sources {
+		newNames[src.Name] = true
+	}
+
+	var removed []string
+	for name := range oldNames {
+		if !newNames[name] {
+			removed = append(removed, name)
+		}
+	}
+
+	m.mu.Lock()
+	for name, entryID := range m.entries {
+		m.cronSvc.Remove(entryID)
+		delete(m.entries, name)
+	}
+	for _, name := range removed {
+		delete(m.status, name)
+	}
+	m.mu.Unlock()
+
+	if len(removed) > 0 {
+		if err := pruneSources(removed); err != nil {
+			logWarn("重新加载配置后清理已移除数据源失败: %v", err)
+		}
+	}
+
+	return m.start()
+}
+
+// pruneSources 从sourceDataCache中删除指定数据源的残留数据并触发一次全量合并重建
+func pruneSources(names []string) error {
+	rebuildMu.Lock()
+	defer rebuildMu.Unlock()
+
+	sourceDataMu.Lock()
+	for _, name := range names {
+		delete(sourceDataCache, name)
+	}
+	snapshot := make([]sourceTV, 0, len(sourceDataCache))
+	for _, sd := range sourceDataCache {
+		snapshot = append(snapshot, sd)
+	}
+	sourceDataMu.Unlock()
+
+	if err := buildEPGCache(snapshot); err != nil {
+		return fmt.Errorf("合并缓存失败: %w", err)
+	}
+	return saveCache()
+}
+
+var subscriptionMgr *SubscriptionManager
+
+// sourceDataCache 保存每个数据源最近一次解析成功的XMLTV数据，用于全量合并重建。
+// 它只存在于内存中，进程重启后为空——必须在启动时调用restoreSourceDataCache从磁盘快照恢复，
+// 否则某个数据源若在重启后第一次抓取就命中304 Not Modified（没有触发真正的解析），
+// 该数据源会一直缺席于sourceDataCache，直到upstream变化为止，期间合并结果会静默丢失这个数据源的节目。
+var (
+	sourceDataMu    sync.RWMutex
+	sourceDataCache = make(map[string]sourceTV)
+	// rebuildMu 串行化"快照sourceDataCache并重建epgCache"这一整个序列：
+	// cron.v3为每个数据源的定时任务各开一个goroutine，两个数据源调度重合
+	// 或手动/run与cron tick并发时，若不加锁，较慢的一次重建可能拿着较旧的快照
+	// 在较新的重建之后才Store，从而用旧数据覆盖掉刚合并进来的新数据。
+	rebuildMu sync.Mutex
+)
+
+// restoreSourceDataCache 在进程启动时从磁盘快照恢复sourceDataCache，
+// 使得某个数据源重启后第一次抓取就命中304 Not Modified时，仍然能参与合并重建。
+func restoreSourceDataCache() {
+	sourceDataMu.Lock()
+	defer sourceDataMu.Unlock()
+
+	for _, src := range config.Sources {
+		tv, ok := loadSourceSnapshot(src.Name)
+		if !ok {
+			continue
+		}
+		sourceDataCache[src.Name] = sourceTV{name: src.Name, priority: src.Priority, tv: tv}
+	}
+}
+
+// refreshSource 下载（响应体整体读入内存）并解析单个数据源，然后串行地快照全部数据源并触发一次全量合并重建；
+// 若上游返回304 Not Modified则跳过本次解析与重建。
+func refreshSource(src SourceConfig) error {
+	tv, notModified, err := fetchSourceTV(src)
+	if err != nil {
+		return err
+	}
+	if notModified {
+		return nil
+	}
+
+	applyChannelAliases(tv, src.ChannelAliases)
+
+	if err := saveSourceSnapshot(src.Name, tv); err != nil {
+		logWarn("[%s] 保存数据源快照失败: %v", src.Name, err)
+	}
+
+	rebuildMu.Lock()
+	defer rebuildMu.Unlock()
+
+	sourceDataMu.Lock()
+	sourceDataCache[src.Name] = sourceTV{name: src.Name, priority: src.Priority, tv: tv}
+	snapshot := make([]sourceTV, 0, len(sourceDataCache))
+	for _, sd := range sourceDataCache {
+		snapshot = append(snapshot, sd)
+	}
+	sourceDataMu.Unlock()
+
+	if err := buildEPGCache(snapshot); err != nil {
+		return fmt.Errorf("合并缓存失败: %w", err)
+	}
+
+	return saveCache()
+}
+
+// applyChannelAliases 将数据源自身的频道ID替换为统一的频道ID，便于跨数据源合并
+func applyChannelAliases(tv *TV, aliases map[string]string) {
+	if len(aliases) == 0 {
+		return
+	}
+	for i := range tv.Channels {
+		if alias, ok := aliases[tv.Channels[i].ID]; ok {
+			tv.Channels[i].ID = alias
+		}
+	}
+	for i := range tv.Programmes {
+		if alias, ok := aliases[tv.Programmes[i].Channel]; ok {
+			tv.Programmes[i].Channel = alias
+		}
+	}
+}
+
+// adminSourcesHandler 处理 GET /admin/sources，返回各数据源的最新状态
+func adminSourcesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeJSONError(w, "仅支持GET方法")
+		return
+	}
+	json.NewEncoder(w).Encode(subscriptionMgr.snapshot())
+}
+
+// adminSourceRunHandler 处理 POST /admin/sources/{name}/run，手动触发某个数据源的抓取
+func adminSourceRunHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeJSONError(w, "仅支持POST方法")
+		return
+	}
+
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/sources/"), "/run")
+	if name == "" {
+		writeJSONError(w, "缺少数据源名称")
+		return
+	}
+
+	if err := subscriptionMgr.runByName(name); err != nil {
+		writeJSONError(w, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "started"})
+}
+
+// adminReloadHandler 处理 POST /admin/reload，热加载YAML配置并重建定时任务
+func adminReloadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeJSONError(w, "仅支持POST方法")
+		return
+	}
+
+	if err := subscriptionMgr.reload(); err != nil {
+		writeJSONError(w, fmt.Sprintf("重新加载配置失败: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "reloaded"})
+}
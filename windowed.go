@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// nowHandler 处理 GET /now?ch=...，返回服务器当前时间正在播出的节目
+func nowHandler(w http.ResponseWriter, r *http.Request) {
+	windowedQueryHandler(w, r, time.Now())
+}
+
+// atHandler 处理 GET /at?ch=...&time=2025-01-05T20:30:00+08:00，返回指定时刻正在播出的节目
+func atHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	timeStr := r.URL.Query().Get("time")
+	if timeStr == "" {
+		writeJSONError(w, "参数缺失，必须提供time参数")
+		return
+	}
+	at, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		writeJSONError(w, "time参数格式错误，需符合RFC3339，如2025-01-05T20:30:00+08:00")
+		return
+	}
+	windowedQueryHandler(w, r, at)
+}
+
+// windowedQueryHandler 是now/at共用的逻辑：在频道的有序节目列表上二分查找覆盖给定时刻的节目，
+// 不需要像逐日扫描那样关心节目是否跨越了日期边界。
+// Before/After比较的是ProgramItem.Start/End代表的绝对时刻，与at参数或time.Now()各自携带什么
+// 时区无关——这依赖parseEPGTime已经用数据源自带的±hhmm偏移构建出正确的瞬间，
+// 而不是笼统套用服务器的config.Server.TimeZone。
+func windowedQueryHandler(w http.ResponseWriter, r *http.Request, at time.Time) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	query := r.URL.Query()
+	chName := query.Get("ch")
+	lang := query.Get("lang")
+	if lang == "" {
+		lang = defaultLang
+	}
+	if chName == "" {
+		writeJSONError(w, "参数缺失，必须提供ch参数")
+		return
+	}
+
+	cache := epgCache.Load()
+	chID, ok := resolveChannelByLang(cache, lang, chName)
+	if !ok {
+		writeJSONError(w, fmt.Sprintf("未找到频道: %s", chName))
+		return
+	}
+
+	items := cache.sortedProgramsForChannel(chID)
+	// sort.Search找到第一个End在at之后的节目：可能正在播出（Start<=at<End），
+	// 也可能是at之后最近的一个未来节目（此时需要再判断Start是否已经到达at）
+	idx := sort.Search(len(items), func(i int) bool { return items[i].End.After(at) })
+	if idx >= len(items) || items[idx].Start.After(at) {
+		writeJSONError(w, fmt.Sprintf("频道%s在%s没有正在播出的节目", chName, at.Format(time.RFC3339)))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"channel_name": chName,
+		"time":         at.Format(time.RFC3339),
+		"program":      items[idx],
+	})
+}
+
+// nextHandler 处理 GET /next?ch=...&n=3，返回从当前时间起接下来的N个节目，可跨日期边界
+func nextHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	query := r.URL.Query()
+	chName := query.Get("ch")
+	lang := query.Get("lang")
+	if lang == "" {
+		lang = defaultLang
+	}
+	if chName == "" {
+		writeJSONError(w, "参数缺失，必须提供ch参数")
+		return
+	}
+
+	n := 1
+	if nStr := query.Get("n"); nStr != "" {
+		parsed, err := strconv.Atoi(nStr)
+		if err != nil || parsed <= 0 {
+			writeJSONError(w, "参数n必须是正整数")
+			return
+		}
+		n = parsed
+	}
+
+	cache := epgCache.Load()
+	chID, ok := resolveChannelByLang(cache, lang, chName)
+	if !ok {
+		writeJSONError(w, fmt.Sprintf("未找到频道: %s", chName))
+		return
+	}
+
+	now := time.Now()
+	items := cache.sortedProgramsForChannel(chID)
+	// 第一个尚未结束的节目：可能正在播出，也可能是严格意义上的未来节目
+	start := sort.Search(len(items), func(i int) bool { return items[i].End.After(now) })
+	end := start + n
+	if end > len(items) {
+		end = len(items)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"channel_name": chName,
+		"programs":     items[start:end],
+	})
+}
+
+// resolveChannelByLang 按指定语言把频道名称解析为频道ID
+func resolveChannelByLang(cache *EPGCache, lang, chName string) (string, bool) {
+	chMap, ok := cache.ChannelMaps[lang]
+	if !ok {
+		return "", false
+	}
+	chID, ok := chMap[chName]
+	return chID, ok
+}
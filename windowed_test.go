@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+// TestSortedProgramsForChannelOrdering 验证finalizeIndex后每个频道的节目按Start升序排列，
+// 这是now/next/at能用sort.Search做二分查找的前提
+func TestSortedProgramsForChannelOrdering(t *testing.T) {
+	c := newEPGCache()
+	base := time.Date(2026, 2, 12, 0, 0, 0, 0, time.UTC)
+
+	c.addProgram("cctv1", "2026-02-12", ProgramItem{Start: base.Add(2 * time.Hour), End: base.Add(3 * time.Hour), Title: "B"})
+	c.addProgram("cctv1", "2026-02-12", ProgramItem{Start: base, End: base.Add(time.Hour), Title: "A"})
+	c.addProgram("cctv1", "2026-02-11", ProgramItem{Start: base.Add(-2 * time.Hour), End: base.Add(-time.Hour), Title: "Z"})
+	c.finalizeIndex()
+
+	items := c.sortedProgramsForChannel("cctv1")
+	if len(items) != 3 {
+		t.Fatalf("期望3条节目，实际%d条", len(items))
+	}
+	for i := 1; i < len(items); i++ {
+		if items[i].Start.Before(items[i-1].Start) {
+			t.Fatalf("节目未按Start升序排列: %v 出现在 %v 之前", items[i-1].Start, items[i].Start)
+		}
+	}
+	if items[0].Title != "Z" || items[2].Title != "B" {
+		t.Fatalf("排序结果不符合预期: %s, %s, %s", items[0].Title, items[1].Title, items[2].Title)
+	}
+}
+
+// TestWindowedSearchFindsCoveringProgram 验证windowedQueryHandler所依赖的sort.Search
+// 二分查找逻辑：能正确定位覆盖给定时刻的节目，而不是相邻的节目
+func TestWindowedSearchFindsCoveringProgram(t *testing.T) {
+	c := newEPGCache()
+	base := time.Date(2026, 2, 12, 0, 0, 0, 0, time.UTC)
+	c.addProgram("cctv1", "2026-02-12", ProgramItem{Start: base, End: base.Add(time.Hour), Title: "A"})
+	c.addProgram("cctv1", "2026-02-12", ProgramItem{Start: base.Add(time.Hour), End: base.Add(2 * time.Hour), Title: "B"})
+	c.finalizeIndex()
+
+	items := c.sortedProgramsForChannel("cctv1")
+	at := base.Add(90 * time.Minute) // 落在B节目区间内
+
+	idx := sort.Search(len(items), func(i int) bool { return items[i].End.After(at) })
+	if idx >= len(items) || items[idx].Start.After(at) {
+		t.Fatalf("未能找到覆盖%v的节目", at)
+	}
+	if items[idx].Title != "B" {
+		t.Fatalf("期望节目B覆盖%v，实际命中%s", at, items[idx].Title)
+	}
+}
+
+// TestWindowedSearchNoCoveringProgram 验证给定时刻落在两个节目的空隙之间时，
+// 查找应失败而不是错误地命中相邻节目
+func TestWindowedSearchNoCoveringProgram(t *testing.T) {
+	c := newEPGCache()
+	base := time.Date(2026, 2, 12, 0, 0, 0, 0, time.UTC)
+	c.addProgram("cctv1", "2026-02-12", ProgramItem{Start: base, End: base.Add(time.Hour), Title: "A"})
+	c.addProgram("cctv1", "2026-02-12", ProgramItem{Start: base.Add(3 * time.Hour), End: base.Add(4 * time.Hour), Title: "B"})
+	c.finalizeIndex()
+
+	items := c.sortedProgramsForChannel("cctv1")
+	at := base.Add(2 * time.Hour) // 在A结束之后、B开始之前，没有节目覆盖
+
+	idx := sort.Search(len(items), func(i int) bool { return items[i].End.After(at) })
+	if idx < len(items) && !items[idx].Start.After(at) {
+		t.Fatalf("不应找到覆盖%v的节目，但命中了%s", at, items[idx].Title)
+	}
+}